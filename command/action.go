@@ -6,12 +6,16 @@ package command
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/hashicorp/nomad/api/contexts"
@@ -54,6 +58,17 @@ Action Specific Options:
     a group and task name must be provided and a random allocation will be
     selected from the job.
 
+  -all
+    Run the action against every running allocation of the group instead
+    of a single, randomly selected allocation. Cannot be combined with
+    -allocation. Disables the tty, since output from multiple allocations
+    is multiplexed to stdout/stderr with each line prefixed by the short
+    allocation ID. Stdin is not passed to the allocations.
+
+  -parallelism <n>
+    When used with -all, limits the number of allocations the action is run
+    against concurrently. Defaults to 0, meaning no limit.
+
   -task <task-name>
     Specifies the task in which the Action is defined. Required if no
     allocation is provided.
@@ -74,6 +89,26 @@ Action Specific Options:
     character is only recognized at the beginning of a line.  The escape character
     followed by a dot ('.') closes the connection.  Setting the character to
     'none' disables any escapes and makes the session fully transparent.
+
+  -record <path>
+    Records the session to path in the asciicast v2 format used by
+    asciinema, for later replay or audit. Requires a tty session.
+
+  -record-input
+    When used with -record, also records stdin. Defaults to false, since
+    session recordings are most often used to audit what an action printed
+    rather than what an operator typed.
+
+  -output <mode>
+    Set to 'json' to disable the tty/escape-char machinery and instead emit
+    a stream of newline-delimited JSON frames to stdout, one per chunk of
+    stdout/stderr plus a final frame carrying the exit code, for consumption
+    by CI systems and other tools. Composes with -all: each frame then
+    carries the short allocation ID it came from.
+
+  -timeout <duration>
+    Cancels the action if it is still running after duration (e.g. "30s",
+    "5m"). Defaults to 0, meaning no timeout.
   `
 	return strings.TrimSpace(helpText)
 }
@@ -88,6 +123,8 @@ func (l *ActionCommand) AutocompleteFlags() complete.Flags {
 			"-task":       complete.PredictAnything,
 			"-job":        complete.PredictAnything,
 			"-allocation": complete.PredictAnything,
+			"-record":     complete.PredictFiles("*"),
+			"-output":     complete.PredictSet("json"),
 		})
 }
 
@@ -110,8 +147,10 @@ func (l *ActionCommand) Name() string { return "action" }
 
 func (l *ActionCommand) Run(args []string) int {
 
-	var stdinOpt, ttyOpt bool
-	var task, allocation, job, group, escapeChar string
+	var stdinOpt, ttyOpt, allOpt, recordInput bool
+	var task, allocation, job, group, escapeChar, recordPath, outputOpt string
+	var parallelism int
+	var timeout time.Duration
 
 	flags := l.Meta.FlagSet(l.Name(), FlagSetClient)
 	flags.Usage = func() { l.Ui.Output(l.Help()) }
@@ -122,6 +161,12 @@ func (l *ActionCommand) Run(args []string) int {
 	flags.BoolVar(&stdinOpt, "i", true, "")
 	flags.BoolVar(&ttyOpt, "t", isTty(), "")
 	flags.StringVar(&escapeChar, "e", "~", "")
+	flags.BoolVar(&allOpt, "all", false, "")
+	flags.IntVar(&parallelism, "parallelism", 0, "")
+	flags.StringVar(&recordPath, "record", "", "")
+	flags.BoolVar(&recordInput, "record-input", false, "")
+	flags.StringVar(&outputOpt, "output", "", "")
+	flags.DurationVar(&timeout, "timeout", 0, "")
 
 	if err := flags.Parse(args); err != nil {
 		l.Ui.Error(fmt.Sprintf("Error parsing flags: %s", err))
@@ -140,11 +185,59 @@ func (l *ActionCommand) Run(args []string) int {
 		return 1
 	}
 
+	if allOpt && allocation != "" {
+		l.Ui.Error("-all cannot be used with -allocation")
+		return 1
+	}
+
+	switch outputOpt {
+	case "", "json":
+	default:
+		l.Ui.Error(fmt.Sprintf("Invalid -output %q, must be \"json\"", outputOpt))
+		return 1
+	}
+
+	if recordPath != "" && allOpt {
+		l.Ui.Error("-record cannot be used with -all")
+		return 1
+	}
+
+	if recordPath != "" && outputOpt == "json" {
+		l.Ui.Error("-record cannot be used with -output=json")
+		return 1
+	}
+
+	if allOpt {
+		// Output from multiple allocations is multiplexed to stdout/stderr,
+		// so there is no single tty session to allocate.
+		ttyOpt = false
+	}
+
+	if outputOpt == "json" {
+		// JSON output is a stream of frames, not raw terminal bytes.
+		ttyOpt = false
+	}
+
 	if ttyOpt && !stdinOpt {
 		l.Ui.Error("-i must be enabled if running with tty")
 		return 1
 	}
 
+	if recordPath != "" && !ttyOpt {
+		l.Ui.Error("-record requires a tty session")
+		return 1
+	}
+
+	if recordInput && recordPath == "" {
+		l.Ui.Error("-record-input requires -record")
+		return 1
+	}
+
+	if timeout < 0 {
+		l.Ui.Error("-timeout must not be negative")
+		return 1
+	}
+
 	if escapeChar == "none" {
 		escapeChar = ""
 	}
@@ -160,6 +253,45 @@ func (l *ActionCommand) Run(args []string) int {
 		return 1
 	}
 
+	if allOpt {
+		if group == "" {
+			l.Ui.Error("A group name is required if no allocation is provided")
+			return 1
+		}
+
+		jobID, ns, err := l.JobIDByPrefix(client, job, nil)
+		if err != nil {
+			l.Ui.Error(err.Error())
+			return 1
+		}
+
+		allocs, err := getJobGroupAllocs(client, jobID, group, ns)
+		if err != nil {
+			l.Ui.Error(fmt.Sprintf("Error fetching allocations: %v", err))
+			return 1
+		}
+
+		if len(allocs) == 0 {
+			l.Ui.Error(fmt.Sprintf("No running allocations found for group %q", group))
+			return 1
+		}
+
+		if !stdinOpt {
+			l.Stdin = bytes.NewReader(nil)
+		}
+		if l.Stdin == nil {
+			l.Stdin = os.Stdin
+		}
+		if l.Stdout == nil {
+			l.Stdout = os.Stdout
+		}
+		if l.Stderr == nil {
+			l.Stderr = os.Stderr
+		}
+
+		return l.execFanOut(client, allocs, task, job, args[0], escapeChar, parallelism, outputOpt == "json", timeout)
+	}
+
 	var allocStub *api.AllocationListStub
 	// If no allocation provided, grab a random one from the job
 	if allocation == "" {
@@ -243,7 +375,24 @@ func (l *ActionCommand) Run(args []string) int {
 
 	action := args[0]
 
-	code, err := l.execImpl(client, alloc, task, job, action, ttyOpt, escapeChar, l.Stdin, l.Stdout, l.Stderr)
+	stdout, stderr := l.Stdout, l.Stderr
+	var frames *jsonFrameWriter
+	if outputOpt == "json" {
+		frames = newJSONFrameWriter(l.Stdout)
+		stdout = frames.streamWriter("", "stdout")
+		stderr = frames.streamWriter("", "stderr")
+	}
+
+	code, err := l.execImpl(client, alloc, task, job, action, ttyOpt, escapeChar, l.Stdin, stdout, stderr, recordPath, recordInput, timeout)
+
+	if frames != nil {
+		frames.writeExit("", code, err)
+		if err != nil {
+			return 1
+		}
+		return code
+	}
+
 	if err != nil {
 		l.Ui.Error(fmt.Sprintf("failed to exec into task: %v", err))
 		return 1
@@ -254,13 +403,19 @@ func (l *ActionCommand) Run(args []string) int {
 
 // execImpl invokes the Alloc Exec api call, it also prepares and restores terminal states as necessary.
 func (l *ActionCommand) execImpl(client *api.Client, alloc *api.Allocation, task string, job string, action string, tty bool,
-	escapeChar string, stdin io.Reader, stdout, stderr io.WriteCloser) (int, error) {
+	escapeChar string, stdin io.Reader, stdout, stderr io.WriteCloser, recordPath string, recordInput bool, timeout time.Duration) (int, error) {
 
 	sizeCh := make(chan api.TerminalSize, 1)
 
 	ctx, cancelFn := context.WithCancel(context.Background())
 	defer cancelFn()
 
+	if timeout > 0 {
+		var timeoutCancelFn context.CancelFunc
+		ctx, timeoutCancelFn = context.WithTimeout(ctx, timeout)
+		defer timeoutCancelFn()
+	}
+
 	// When tty, ensures we capture all user input and monitor terminal resizes.
 	if tty {
 		if stdin == nil {
@@ -285,6 +440,39 @@ func (l *ActionCommand) execImpl(client *api.Client, alloc *api.Allocation, task
 		}
 		defer sizeCleanup()
 
+		if recordPath != "" {
+			width, height := recorderInitialSize(stdout, getTerminalSize)
+
+			rec, err := newSessionRecorder(recordPath, width, height)
+			if err != nil {
+				return -1, err
+			}
+
+			resizeDone := make(chan struct{})
+			recordedSizeCh := make(chan api.TerminalSize, 1)
+			recordedSizeCh <- api.TerminalSize{Width: width, Height: height}
+			go func() {
+				defer close(resizeDone)
+				rec.watchResize(sizeCh, recordedSizeCh, ctx.Done())
+			}()
+			sizeCh = recordedSizeCh
+
+			// cancelFn makes watchResize return by closing ctx.Done(); wait
+			// for it to actually exit before closing rec out from under it,
+			// rather than relying on defer order against the top-level
+			// defer cancelFn() above.
+			defer func() {
+				cancelFn()
+				<-resizeDone
+				rec.Close()
+			}()
+
+			stdout = rec.wrapOutput(stdout)
+			if recordInput {
+				stdin = rec.wrapInput(stdin)
+			}
+		}
+
 		if escapeChar != "" {
 			stdin = escapingio.NewReader(stdin, escapeChar[0], func(c byte) bool {
 				switch c {
@@ -315,3 +503,384 @@ func (l *ActionCommand) execImpl(client *api.Client, alloc *api.Allocation, task
 	return client.Jobs().ActionExec(ctx,
 		alloc, task, tty, make([]string, 0), action, stdin, stdout, stderr, sizeCh, nil)
 }
+
+// terminalSizeFunc queries the current terminal size of stdout, mirroring
+// getTerminalSize's signature so tests can substitute a fake.
+type terminalSizeFunc func(stdout io.Writer) (api.TerminalSize, error)
+
+// recorderInitialSize determines the terminal dimensions to use for a new
+// session recording's asciicast header. It queries getSize synchronously
+// rather than racing watchTerminalSize's background goroutine, falling back
+// to a sane default if the real size can't be determined (e.g. stdout isn't
+// backed by a real terminal).
+func recorderInitialSize(stdout io.Writer, getSize terminalSizeFunc) (width, height int) {
+	width, height = 80, 24
+	if getSize == nil {
+		return width, height
+	}
+	if sz, err := getSize(stdout); err == nil {
+		width, height = sz.Width, sz.Height
+	}
+	return width, height
+}
+
+// getJobGroupAllocs returns the running allocations of the given job and
+// group, for use with -all fan-out.
+func getJobGroupAllocs(client *api.Client, jobID, group string, ns *api.QueryOptions) ([]*api.AllocationListStub, error) {
+	allocs, _, err := client.Jobs().Allocations(jobID, false, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*api.AllocationListStub
+	for _, alloc := range allocs {
+		if alloc.TaskGroup == group && alloc.ClientStatus == api.AllocClientStatusRunning {
+			matched = append(matched, alloc)
+		}
+	}
+
+	return matched, nil
+}
+
+// execFanOut runs action against every allocation in allocs concurrently,
+// bounded by parallelism (0 means unlimited). When jsonOutput is false,
+// output from each allocation is multiplexed to l.Stdout/l.Stderr, prefixed
+// with the allocation's short ID, and a human-readable per-allocation
+// exit-code summary is printed once every invocation completes. When
+// jsonOutput is true, output and the summary are instead emitted as
+// newline-delimited JSON frames to l.Stdout, each carrying the allocation's
+// short ID in its "alloc" field.
+func (l *ActionCommand) execFanOut(client *api.Client, allocs []*api.AllocationListStub, task, job, action, escapeChar string, parallelism int, jsonOutput bool, timeout time.Duration) int {
+	if parallelism <= 0 || parallelism > len(allocs) {
+		parallelism = len(allocs)
+	}
+
+	stdoutMux := newAllocOutputMux(l.Stdout)
+	stderrMux := newAllocOutputMux(l.Stderr)
+	frames := newJSONFrameWriter(l.Stdout)
+
+	type allocResult struct {
+		allocID string
+		code    int
+		err     error
+	}
+
+	results := make([]allocResult, len(allocs))
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for i, stub := range allocs {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, stub *api.AllocationListStub) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			allocID := shortId(stub.ID)
+
+			var stdout, stderr io.WriteCloser
+			if jsonOutput {
+				stdout = frames.streamWriter(allocID, "stdout")
+				stderr = frames.streamWriter(allocID, "stderr")
+			} else {
+				prefix := fmt.Sprintf("[%s] ", allocID)
+				stdout = stdoutMux.writerFor(prefix)
+				stderr = stderrMux.writerFor(prefix)
+			}
+			defer stdout.Close()
+			defer stderr.Close()
+
+			q := &api.QueryOptions{Namespace: stub.Namespace}
+			alloc, _, err := client.Allocations().Info(stub.ID, q)
+			if err != nil {
+				results[i] = allocResult{allocID: stub.ID, code: -1, err: err}
+				return
+			}
+
+			allocTask := task
+			if allocTask != "" {
+				err = validateTaskExistsInAllocation(allocTask, alloc)
+			} else {
+				allocTask, err = lookupAllocTask(alloc)
+			}
+			if err != nil {
+				results[i] = allocResult{allocID: stub.ID, code: -1, err: err}
+				return
+			}
+
+			code, err := l.execImpl(client, alloc, allocTask, job, action, false, escapeChar, bytes.NewReader(nil), stdout, stderr, "", false, timeout)
+			results[i] = allocResult{allocID: stub.ID, code: code, err: err}
+		}(i, stub)
+	}
+	wg.Wait()
+
+	overall := 0
+	if !jsonOutput {
+		l.Ui.Output("\nAction results:")
+	}
+	for _, r := range results {
+		if jsonOutput {
+			frames.writeExit(shortId(r.allocID), r.code, r.err)
+		} else {
+			status := fmt.Sprintf("exit code %d", r.code)
+			if r.err != nil {
+				status = fmt.Sprintf("error: %v", r.err)
+			}
+			l.Ui.Output(fmt.Sprintf("  %s: %s", shortId(r.allocID), status))
+		}
+
+		if r.err != nil || r.code != 0 {
+			overall = 1
+		}
+	}
+
+	return overall
+}
+
+// allocOutputMux serializes concurrent writes from multiple allocations to a
+// shared destination, so that lines from different allocations are never
+// interleaved mid-line.
+type allocOutputMux struct {
+	mu  sync.Mutex
+	dst io.Writer
+}
+
+func newAllocOutputMux(dst io.Writer) *allocOutputMux {
+	return &allocOutputMux{dst: dst}
+}
+
+func (m *allocOutputMux) writerFor(prefix string) io.WriteCloser {
+	return &allocPrefixWriter{mux: m, prefix: prefix}
+}
+
+// allocPrefixWriter buffers partial lines and, under the mux's lock, writes
+// each completed line to the shared destination prefixed with the owning
+// allocation's short ID.
+type allocPrefixWriter struct {
+	mux    *allocOutputMux
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (w *allocPrefixWriter) Write(p []byte) (int, error) {
+	w.mux.mu.Lock()
+	defer w.mux.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		b := w.buf.Bytes()
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf.Next(i + 1)
+		if _, err := fmt.Fprintf(w.mux.dst, "%s%s", w.prefix, line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *allocPrefixWriter) Close() error {
+	w.mux.mu.Lock()
+	defer w.mux.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		fmt.Fprintf(w.mux.dst, "%s%s\n", w.prefix, w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
+
+// actionJSONFrame is one newline-delimited JSON frame emitted in
+// -output=json mode. Alloc is only set when fanning out with -all.
+type actionJSONFrame struct {
+	Alloc  string `json:"alloc,omitempty"`
+	Stream string `json:"stream,omitempty"`
+	Data   string `json:"data,omitempty"`
+	TS     string `json:"ts,omitempty"`
+	Exit   *int   `json:"exit,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// jsonFrameWriter serializes newline-delimited actionJSONFrame values to a
+// shared destination for -output=json, so that frames from different
+// streams, or from concurrent allocations under -all, are never interleaved
+// mid-line.
+type jsonFrameWriter struct {
+	mu  sync.Mutex
+	dst io.Writer
+}
+
+func newJSONFrameWriter(dst io.Writer) *jsonFrameWriter {
+	return &jsonFrameWriter{dst: dst}
+}
+
+func (f *jsonFrameWriter) writeFrame(frame actionJSONFrame) error {
+	line, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.dst.Write(line)
+	return err
+}
+
+// writeExit is best-effort: by the time it's called the action has already
+// finished, so there's no one left to hand a write error back to.
+func (f *jsonFrameWriter) writeExit(alloc string, code int, err error) {
+	frame := actionJSONFrame{Alloc: alloc, Exit: &code}
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	_ = f.writeFrame(frame)
+}
+
+// streamWriter returns a writer that encodes every chunk written to it as a
+// base64 data frame on the given stream ("stdout" or "stderr").
+func (f *jsonFrameWriter) streamWriter(alloc, stream string) io.WriteCloser {
+	return &jsonStreamWriter{frames: f, alloc: alloc, stream: stream}
+}
+
+type jsonStreamWriter struct {
+	frames *jsonFrameWriter
+	alloc  string
+	stream string
+}
+
+func (w *jsonStreamWriter) Write(p []byte) (int, error) {
+	if err := w.frames.writeFrame(actionJSONFrame{
+		Alloc:  w.alloc,
+		Stream: w.stream,
+		Data:   base64.StdEncoding.EncodeToString(p),
+		TS:     time.Now().UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *jsonStreamWriter) Close() error {
+	return nil
+}
+
+// sessionRecorder captures an interactive `nomad action` session to an
+// asciinema v2 (asciicast) compatible file, so the session can be replayed
+// or audited later without needing to run script(1) inside the container.
+type sessionRecorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	start time.Time
+}
+
+// newSessionRecorder creates path and writes the asciicast header line using
+// the given initial terminal dimensions.
+func newSessionRecorder(path string, width, height int) (*sessionRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &sessionRecorder{f: f, start: time.Now()}
+
+	header := map[string]any{
+		"version":   2,
+		"width":     width,
+		"height":    height,
+		"timestamp": rec.start.Unix(),
+		"env": map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	}
+	if err := json.NewEncoder(f).Encode(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// writeEvent appends one asciicast event line: [elapsedSeconds, code, data].
+func (r *sessionRecorder) writeEvent(code, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]any{elapsed, code, data})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	r.f.Write(line)
+}
+
+func (r *sessionRecorder) Close() error {
+	return r.f.Close()
+}
+
+// wrapOutput returns a writer that records every chunk written to it as an
+// "o" (output) event before forwarding the bytes to dst.
+func (r *sessionRecorder) wrapOutput(dst io.WriteCloser) io.WriteCloser {
+	return &recordingWriteCloser{rec: r, code: "o", dst: dst}
+}
+
+// wrapInput returns a reader that records every chunk read from src as an
+// "i" (input) event before returning the bytes to the caller.
+func (r *sessionRecorder) wrapInput(src io.Reader) io.Reader {
+	return &recordingReader{rec: r, code: "i", src: src}
+}
+
+// watchResize drains resize events from in, records each as an "r" event,
+// and forwards it to out, until in is closed or done fires.
+func (r *sessionRecorder) watchResize(in <-chan api.TerminalSize, out chan<- api.TerminalSize, done <-chan struct{}) {
+	for {
+		select {
+		case sz, ok := <-in:
+			if !ok {
+				return
+			}
+			r.writeEvent("r", fmt.Sprintf("%dx%d", sz.Width, sz.Height))
+			select {
+			case out <- sz:
+			case <-done:
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+type recordingWriteCloser struct {
+	rec  *sessionRecorder
+	code string
+	dst  io.WriteCloser
+}
+
+func (w *recordingWriteCloser) Write(p []byte) (int, error) {
+	w.rec.writeEvent(w.code, string(p))
+	return w.dst.Write(p)
+}
+
+func (w *recordingWriteCloser) Close() error {
+	return w.dst.Close()
+}
+
+type recordingReader struct {
+	rec  *sessionRecorder
+	code string
+	src  io.Reader
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if n > 0 {
+		r.rec.writeEvent(r.code, string(p[:n]))
+	}
+	return n, err
+}
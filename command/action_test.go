@@ -0,0 +1,298 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestAllocPrefixWriter_Write(t *testing.T) {
+	cases := []struct {
+		name   string
+		writes []string
+		close  bool
+		want   string
+	}{
+		{
+			name:   "single complete line",
+			writes: []string{"hello\n"},
+			want:   "[abc123] hello\n",
+		},
+		{
+			name:   "multiple lines in one write",
+			writes: []string{"one\ntwo\nthree\n"},
+			want:   "[abc123] one\n[abc123] two\n[abc123] three\n",
+		},
+		{
+			name:   "partial line across writes",
+			writes: []string{"hel", "lo\n"},
+			want:   "[abc123] hello\n",
+		},
+		{
+			name:   "trailing partial line without close",
+			writes: []string{"complete\nincomplete"},
+			want:   "[abc123] complete\n",
+		},
+		{
+			name:   "trailing partial line flushed on close",
+			writes: []string{"complete\nincomplete"},
+			close:  true,
+			want:   "[abc123] complete\n[abc123] incomplete\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			mux := newAllocOutputMux(&buf)
+			w := mux.writerFor("[abc123] ")
+
+			for _, chunk := range tc.writes {
+				if _, err := w.Write([]byte(chunk)); err != nil {
+					t.Fatalf("Write returned error: %v", err)
+				}
+			}
+
+			if tc.close {
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close returned error: %v", err)
+				}
+			}
+
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAllocPrefixWriter_ConcurrentWritesDoNotInterleave(t *testing.T) {
+	var buf bytes.Buffer
+	mux := newAllocOutputMux(&buf)
+
+	a := mux.writerFor("[a] ")
+	b := mux.writerFor("[b] ")
+
+	// Concurrent Write calls from two allocations must each produce whole,
+	// un-interleaved lines in the shared destination.
+	var wg sync.WaitGroup
+	var errA, errB error
+	wg.Add(2)
+	go func() { defer wg.Done(); _, errA = a.Write([]byte("line-a\n")) }()
+	go func() { defer wg.Done(); _, errB = b.Write([]byte("line-b\n")) }()
+	wg.Wait()
+
+	if errA != nil {
+		t.Fatalf("unexpected error: %v", errA)
+	}
+	if errB != nil {
+		t.Fatalf("unexpected error: %v", errB)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "[a] line-a\n") || !strings.Contains(out, "[b] line-b\n") {
+		t.Fatalf("expected both prefixed lines intact, got %q", out)
+	}
+}
+
+// errWriter always fails, to exercise error propagation out of jsonFrameWriter.
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestJSONFrameWriter_StreamWriterFrameShape(t *testing.T) {
+	var buf bytes.Buffer
+	frames := newJSONFrameWriter(&buf)
+
+	w := frames.streamWriter("abc123", "stdout")
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var frame actionJSONFrame
+	if err := json.Unmarshal(buf.Bytes(), &frame); err != nil {
+		t.Fatalf("failed to unmarshal frame: %v", err)
+	}
+
+	if frame.Alloc != "abc123" {
+		t.Errorf("Alloc = %q, want %q", frame.Alloc, "abc123")
+	}
+	if frame.Stream != "stdout" {
+		t.Errorf("Stream = %q, want %q", frame.Stream, "stdout")
+	}
+	if frame.TS == "" {
+		t.Error("TS must be set")
+	}
+	if frame.Exit != nil {
+		t.Errorf("Exit = %v, want nil", frame.Exit)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(frame.Data)
+	if err != nil {
+		t.Fatalf("Data is not valid base64: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("decoded Data = %q, want %q", string(data), "hello")
+	}
+}
+
+func TestJSONFrameWriter_WriteExit(t *testing.T) {
+	var buf bytes.Buffer
+	frames := newJSONFrameWriter(&buf)
+
+	frames.writeExit("abc123", 2, errors.New("boom"))
+
+	var frame actionJSONFrame
+	if err := json.Unmarshal(buf.Bytes(), &frame); err != nil {
+		t.Fatalf("failed to unmarshal frame: %v", err)
+	}
+
+	if frame.Alloc != "abc123" {
+		t.Errorf("Alloc = %q, want %q", frame.Alloc, "abc123")
+	}
+	if frame.Exit == nil || *frame.Exit != 2 {
+		t.Errorf("Exit = %v, want 2", frame.Exit)
+	}
+	if frame.Error != "boom" {
+		t.Errorf("Error = %q, want %q", frame.Error, "boom")
+	}
+}
+
+func TestJSONStreamWriter_PropagatesWriteError(t *testing.T) {
+	wantErr := errors.New("broken pipe")
+	frames := newJSONFrameWriter(errWriter{err: wantErr})
+
+	w := frames.streamWriter("abc123", "stdout")
+	n, err := w.Write([]byte("hello"))
+
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Write error = %v, want %v", err, wantErr)
+	}
+	if n != 0 {
+		t.Errorf("Write n = %d, want 0 on error", n)
+	}
+}
+
+func TestRecorderInitialSize(t *testing.T) {
+	cases := []struct {
+		name       string
+		getSize    terminalSizeFunc
+		wantWidth  int
+		wantHeight int
+	}{
+		{
+			name: "uses the real size when available",
+			getSize: func(io.Writer) (api.TerminalSize, error) {
+				return api.TerminalSize{Width: 200, Height: 50}, nil
+			},
+			wantWidth:  200,
+			wantHeight: 50,
+		},
+		{
+			name: "falls back to the default when the size can't be determined",
+			getSize: func(io.Writer) (api.TerminalSize, error) {
+				return api.TerminalSize{}, errors.New("not a terminal")
+			},
+			wantWidth:  80,
+			wantHeight: 24,
+		},
+		{
+			name:       "falls back to the default when no getSize func is given",
+			getSize:    nil,
+			wantWidth:  80,
+			wantHeight: 24,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			width, height := recorderInitialSize(&bytes.Buffer{}, tc.getSize)
+			if width != tc.wantWidth || height != tc.wantHeight {
+				t.Errorf("got %dx%d, want %dx%d", width, height, tc.wantWidth, tc.wantHeight)
+			}
+		})
+	}
+}
+
+func TestSessionRecorder_HeaderAndEvents(t *testing.T) {
+	path := t.TempDir() + "/session.cast"
+
+	rec, err := newSessionRecorder(path, 120, 40)
+	if err != nil {
+		t.Fatalf("newSessionRecorder failed: %v", err)
+	}
+
+	out := rec.wrapOutput(nopWriteCloser{})
+	if _, err := out.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec.writeEvent("r", "120x40")
+
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	lines := readLines(t, path)
+	if len(lines) != 3 {
+		t.Fatalf("expected header + 2 events, got %d lines: %v", len(lines), lines)
+	}
+
+	var header map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("failed to unmarshal header: %v", err)
+	}
+	if header["version"].(float64) != 2 {
+		t.Errorf("version = %v, want 2", header["version"])
+	}
+	if header["width"].(float64) != 120 || header["height"].(float64) != 40 {
+		t.Errorf("dimensions = %v/%v, want 120/40", header["width"], header["height"])
+	}
+
+	var outputEvent []any
+	if err := json.Unmarshal([]byte(lines[1]), &outputEvent); err != nil {
+		t.Fatalf("failed to unmarshal output event: %v", err)
+	}
+	if outputEvent[1] != "o" || outputEvent[2] != "hello\n" {
+		t.Errorf("output event = %v, want [elapsed, \"o\", \"hello\\n\"]", outputEvent)
+	}
+
+	var resizeEvent []any
+	if err := json.Unmarshal([]byte(lines[2]), &resizeEvent); err != nil {
+		t.Fatalf("failed to unmarshal resize event: %v", err)
+	}
+	if resizeEvent[1] != "r" || resizeEvent[2] != "120x40" {
+		t.Errorf("resize event = %v, want [elapsed, \"r\", \"120x40\"]", resizeEvent)
+	}
+}
+
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriteCloser) Close() error                { return nil }
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+
+	trimmed := strings.TrimRight(string(data), "\n")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "\n")
+}
@@ -7,12 +7,21 @@
 
 package structs
 
-import "slices"
+import (
+	"slices"
+	"time"
+)
 
 type Action struct {
 	Name    string
 	Command string
 	Args    []string
+
+	// Timeout is how long the action may run; a zero value means no limit.
+	// It is copied and compared with the action but is not read when the
+	// action is run, so it is not enforced; `nomad action -timeout` bounds
+	// a single run instead.
+	Timeout time.Duration
 }
 
 type JobAction struct {
@@ -45,5 +54,6 @@ func (a *Action) Equal(o *Action) bool {
 	}
 	return a.Name == o.Name &&
 		a.Command == o.Command &&
-		slices.Equal(a.Args, o.Args)
+		slices.Equal(a.Args, o.Args) &&
+		a.Timeout == o.Timeout
 }
@@ -46,16 +46,19 @@ func (n *NUMA) Copy() *NUMA {
 	}
 }
 
+// Validate ensures the NUMA block is internally consistent.
 func (n *NUMA) Validate() error {
 	if n == nil {
 		return nil
 	}
+
 	switch n.Affinity {
 	case NoneNUMA, PreferNUMA, RequireNUMA:
-		return nil
 	default:
 		return errors.New("numa affinity must be one of none, prefer, or require")
 	}
+
+	return nil
 }
 
 // Requested returns true if the NUMA.Affinity is set to one of "prefer" or
@@ -0,0 +1,54 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package structs
+
+import (
+	"testing"
+)
+
+func TestNUMA_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		numa    *NUMA
+		wantErr bool
+	}{
+		{
+			name:    "nil is valid",
+			numa:    nil,
+			wantErr: false,
+		},
+		{
+			name:    "none affinity",
+			numa:    &NUMA{Affinity: NoneNUMA},
+			wantErr: false,
+		},
+		{
+			name:    "prefer affinity",
+			numa:    &NUMA{Affinity: PreferNUMA},
+			wantErr: false,
+		},
+		{
+			name:    "require affinity",
+			numa:    &NUMA{Affinity: RequireNUMA},
+			wantErr: false,
+		},
+		{
+			name:    "unknown affinity",
+			numa:    &NUMA{Affinity: "bogus"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.numa.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}